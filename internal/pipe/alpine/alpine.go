@@ -3,6 +3,9 @@ package alpine
 
 import (
 	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +13,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/apex/log"
@@ -59,8 +63,8 @@ func (Pipe) Default(ctx *context.Context) error {
 			alpine.Repository = "main"
 		}
 
-		if pubKeyPath == "" || privKeyPath == "" {
-			return ErrNoAlpineKeys
+		if err := ensureKeys(ctx, alpine); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -77,124 +81,440 @@ func (Pipe) Run(ctx *context.Context) error {
 		artifacts := ctx.Artifacts.Filter(
 			artifact.And(
 				artifact.ByGoos("linux"),
-				artifact.ByGoarm(""),
 				artifact.ByType(artifact.Binary),
 			),
 		).List()
 
 		log.Debugf("will build %d artifacts", len(artifacts))
 
-		pwd, err := os.Getwd()
-		if err != nil {
+		localPath := filepath.Join(ctx.Config.Dist, "alpine-"+alpine.Name)
+		if err := os.MkdirAll(localPath, 0700); err != nil {
 			return err
 		}
 
-		localPath := filepath.Join(ctx.Config.Dist, "alpine-"+alpine.Name)
-		localPathAbs := filepath.Join(pwd, localPath)
+		if alpine.UseABuild {
+			if err := runWithABuild(ctx, alpine, localPath, artifacts); err != nil {
+				return err
+			}
+			continue
+		}
 
-		err = os.MkdirAll(localPath, 0700)
-		if err != nil {
+		if err := runNative(ctx, alpine, localPath, artifacts); err != nil {
 			return err
 		}
+	}
 
-		apkBuild, err := generateApkBuildFile(ctx, alpine)
-		if err != nil {
-			return err
+	return nil
+}
+
+// runNative builds .apk files and an APKINDEX.tar.gz in pure Go, without
+// shelling out to abuild/abuild-sign.
+func runNative(ctx *context.Context, alpine config.Alpine, localPath string, artifacts []artifact.Artifact) error {
+	key, err := loadPrivateKey(alpine.Key.PrivKeyPath)
+	if err != nil {
+		return fmt.Errorf("alpine: failed to load signing key: %w", err)
+	}
+	pubKeyName := signatureKeyName(alpine.Key.PubKeyPath)
+
+	repoPath := filepath.Join(alpine.Root, alpine.Branch, alpine.Repository)
+
+	noarchIDs := map[string]bool{}
+	for _, id := range alpine.NoarchIDs {
+		noarchIDs[id] = true
+	}
+
+	byArch := map[string][]artifact.Artifact{}
+	for _, binArtifact := range artifacts {
+		arch := toAlpineArch(binArtifact.Goarch, binArtifact.Goarm)
+		buildID, _ := binArtifact.Extra["ID"].(string)
+		if alpine.Arch == "noarch" || noarchIDs[buildID] {
+			arch = "noarch"
 		}
+		byArch[arch] = append(byArch[arch], binArtifact)
+	}
 
-		log.WithField(apkBuildFileName, localPath).Info("writing")
-		err = ioutil.WriteFile(filepath.Join(localPath, apkBuildFileName), apkBuild, 0644)
+	noarchArtifacts := byArch["noarch"]
+	delete(byArch, "noarch")
+
+	// a bare `noarch` package still needs a home: if every artifact ended
+	// up there (alpine.Arch: noarch), publish it on its own.
+	if len(byArch) == 0 && len(noarchArtifacts) > 0 {
+		byArch["noarch"] = noarchArtifacts
+		noarchArtifacts = nil
+	}
 
-		if _, err = exec.LookPath("abuild"); err != nil {
+	var noarchEntry *indexEntry
+	var noarchApkPath string
+	if len(noarchArtifacts) > 0 {
+		canonicalPath := filepath.Join(localPath, "noarch")
+		if err := os.MkdirAll(canonicalPath, 0700); err != nil {
 			return err
 		}
 
-		repoPath := filepath.Join(alpine.Root, alpine.Branch, alpine.Repository)
-		pubKeyName := filepath.Dir(pubKeyPath)
-
-		for _, binArtifact := range artifacts {
-			arch := binArtifact.Goarch
-			switch arch {
-			case "386":
-				arch = "x86"
-			case "amd64":
-				arch = "x86_64"
-			}
+		entry, apkPath, err := buildNoarchApk(ctx, alpine, canonicalPath, noarchArtifacts, key, pubKeyName)
+		if err != nil {
+			return err
+		}
+		noarchEntry = &entry
+		noarchApkPath = apkPath
+	}
 
-			artifactRepoPath := filepath.Join(repoPath, arch)
+	for arch, binArtifacts := range byArch {
+		archPath := filepath.Join(localPath, arch)
+		if err := os.MkdirAll(archPath, 0700); err != nil {
+			return err
+		}
 
-			binDir := filepath.Join(localPath, arch)
-			err := os.Mkdir(binDir, 0700)
-			if err != nil {
-				return err
-			}
+		artifactRepoPath := filepath.Join(repoPath, arch)
 
-			binary, err := os.Open(binArtifact.Path)
-			if err != nil {
-				return err
-			}
+		// every binary built for this arch goes into a single .apk, the
+		// same way the abuild path packages one APKBUILD per arch -
+		// building one .apk per binary would have each overwrite the
+		// last, since they'd all share the same package name/version.
+		binaries := map[string]string{}
+		for _, binArtifact := range binArtifacts {
+			binaries[filepath.Base(binArtifact.Path)] = binArtifact.Path
+		}
 
-			destPath := filepath.Join(binDir, filepath.Base(binArtifact.Path))
-			destination, err := os.Create(destPath)
-			if err != nil {
-				return err
-			}
-			os.Chmod(destPath, 0555)
+		apkFileName := fmt.Sprintf("%s-%s-r%d.apk", alpine.Name, ctx.Version, alpine.Rel)
+		apkFilePath := filepath.Join(archPath, apkFileName)
+
+		info := pkgInfo{
+			Name:        alpine.Name,
+			Version:     fmt.Sprintf("%s-r%d", ctx.Version, alpine.Rel),
+			Description: alpine.Description,
+			URL:         alpine.URL,
+			BuildDate:   nowUnix(),
+			Packager:    alpine.Maintainer,
+			Arch:        arch,
+			Origin:      alpine.Name,
+			Commit:      ctx.Git.Commit,
+			License:     alpine.License,
+		}
 
-			_, err = io.Copy(destination, binary)
-			if err != nil {
-				return err
-			}
+		installedSize, checksum, dataHash, err := buildAPK(apkFilePath, info, binaries, key, pubKeyName)
+		if err != nil {
+			return fmt.Errorf("alpine: failed to build apk for %s: %w", arch, err)
+		}
 
-			cmd := exec.Command("abuild", "-P", localPathAbs, "-r")
-			cmd.Env = append(os.Environ(), "CBUILD="+arch)
-			cmd.Dir = localPath
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				return fmt.Errorf("%s:\n%s", err, string(output))
-			}
+		apkFileInfo, err := os.Stat(apkFilePath)
+		if err != nil {
+			return fmt.Errorf("alpine: failed to stat apk for %s: %w", arch, err)
+		}
 
-			artifactMeta := map[string]interface{}{
+		ctx.Artifacts.Add(artifact.Artifact{
+			Type:    artifact.APK,
+			Name:    apkFileName,
+			Path:    apkFilePath,
+			Goos:    "linux",
+			Goarch:  binArtifacts[0].Goarch,
+			Goarm:   "",
+			RepoDir: artifactRepoPath,
+			Extra: map[string]interface{}{
 				"AlpineArch": arch,
-			}
-
-			abuildOutputPath := filepath.Join(localPath, abuildOutputDir, arch)
+			},
+		})
+
+		entries := []indexEntry{
+			{
+				Checksum:      checksum,
+				Name:          alpine.Name,
+				Version:       info.Version,
+				Arch:          arch,
+				Size:          apkFileInfo.Size(),
+				InstalledSize: installedSize,
+				Description:   alpine.Description,
+				URL:           alpine.URL,
+				License:       alpine.License,
+				Origin:        info.Origin,
+				BuildDate:     info.BuildDate,
+				DataHash:      dataHash,
+			},
+		}
 
-			apkFileName := fmt.Sprintf("%s-%s-r%d.apk", alpine.Name, ctx.Version, alpine.Rel)
-			apkFilePath := filepath.Join(abuildOutputPath, apkFileName)
+		// apk only ever fetches <repo>/<arch>/APKINDEX.tar.gz directly, never
+		// an <arch>/noarch/ subtree, so noarch packages have to be copied
+		// into and listed alongside every real arch's own index instead.
+		if arch != "noarch" && noarchEntry != nil {
+			noarchDest := filepath.Join(archPath, filepath.Base(noarchApkPath))
+			if err := copyFile(noarchApkPath, noarchDest); err != nil {
+				return err
+			}
 
 			ctx.Artifacts.Add(artifact.Artifact{
 				Type:    artifact.APK,
-				Name:    apkFileName,
-				Path:    apkFilePath,
+				Name:    filepath.Base(noarchApkPath),
+				Path:    noarchDest,
 				Goos:    "linux",
-				Goarch:  binArtifact.Goarch,
-				Goarm:   "",
+				Goarch:  "noarch",
 				RepoDir: artifactRepoPath,
-				Extra:   artifactMeta,
+				Extra: map[string]interface{}{
+					"AlpineArch": arch,
+				},
 			})
 
-			apkIndexPath := filepath.Join(abuildOutputPath, apkIndexFileName)
-			apkIndexPathAbs := filepath.Join(pwd, apkIndexPath)
+			entries = append(entries, *noarchEntry)
+		}
 
-			cmd = exec.Command("abuild-sign", apkIndexPathAbs, "-p", pubKeyName)
-			cmd.Dir = localPath
-			output, err = cmd.CombinedOutput()
-			if err != nil {
-				return fmt.Errorf("%s:\n%s", err, string(output))
-			}
+		apkIndexPath := filepath.Join(archPath, apkIndexFileName)
+		if err := buildAPKIndex(apkIndexPath, alpine.Description, entries, key, pubKeyName); err != nil {
+			return fmt.Errorf("alpine: failed to build APKINDEX for %s: %w", arch, err)
+		}
 
-			ctx.Artifacts.Add(artifact.Artifact{
-				Type:    artifact.APKIndex,
-				Name:    apkIndexFileName,
-				Path:    apkIndexPath,
-				Goos:    "linux",
-				Goarch:  binArtifact.Goarch,
-				Goarm:   "",
-				RepoDir: artifactRepoPath,
-				Extra:   artifactMeta,
-			})
+		ctx.Artifacts.Add(artifact.Artifact{
+			Type:    artifact.APKIndex,
+			Name:    apkIndexFileName,
+			Path:    apkIndexPath,
+			Goos:    "linux",
+			RepoDir: artifactRepoPath,
+			Extra: map[string]interface{}{
+				"AlpineArch": arch,
+			},
+		})
+	}
+
+	return nil
+}
+
+// buildNoarchApk bundles every artifact marked noarch (via `alpine.arch:
+// noarch` or `alpine.noarch_ids`) into a single .apk under dir, the same way
+// runNative bundles each real arch's binaries into one package. It returns
+// the package's index entry and its on-disk path so the caller can copy it
+// into and list it in every real arch's own index - apk only ever fetches
+// <repo>/<arch>/APKINDEX.tar.gz directly and never descends into an
+// <arch>/noarch/ subtree, so that's the only way clients ever see it.
+func buildNoarchApk(ctx *context.Context, alpine config.Alpine, dir string, noarchArtifacts []artifact.Artifact, key *rsa.PrivateKey, pubKeyName string) (indexEntry, string, error) {
+	binaries := map[string]string{}
+	for _, binArtifact := range noarchArtifacts {
+		binaries[filepath.Base(binArtifact.Path)] = binArtifact.Path
+	}
+
+	// named <name>-noarch so its copy in each arch directory sits beside,
+	// rather than replaces, that arch's own <name>-<version>.apk.
+	noarchName := alpine.Name + "-noarch"
+	apkFileName := fmt.Sprintf("%s-%s-r%d.apk", noarchName, ctx.Version, alpine.Rel)
+	apkFilePath := filepath.Join(dir, apkFileName)
+
+	info := pkgInfo{
+		Name:        noarchName,
+		Version:     fmt.Sprintf("%s-r%d", ctx.Version, alpine.Rel),
+		Description: alpine.Description,
+		URL:         alpine.URL,
+		BuildDate:   nowUnix(),
+		Packager:    alpine.Maintainer,
+		Arch:        "noarch",
+		Origin:      alpine.Name,
+		Commit:      ctx.Git.Commit,
+		License:     alpine.License,
+	}
+
+	installedSize, checksum, dataHash, err := buildAPK(apkFilePath, info, binaries, key, pubKeyName)
+	if err != nil {
+		return indexEntry{}, "", fmt.Errorf("alpine: failed to build noarch apk: %w", err)
+	}
+
+	apkFileInfo, err := os.Stat(apkFilePath)
+	if err != nil {
+		return indexEntry{}, "", fmt.Errorf("alpine: failed to stat noarch apk: %w", err)
+	}
+
+	return indexEntry{
+		Checksum:      checksum,
+		Name:          noarchName,
+		Version:       info.Version,
+		Arch:          "noarch",
+		Size:          apkFileInfo.Size(),
+		InstalledSize: installedSize,
+		Description:   alpine.Description,
+		URL:           alpine.URL,
+		License:       alpine.License,
+		Origin:        info.Origin,
+		BuildDate:     info.BuildDate,
+		DataHash:      dataHash,
+	}, apkFilePath, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// loadPrivateKey reads and PEM-decodes the RSA private key used to sign
+// packages and indexes.
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from %s", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// signatureKeyName returns the name abuild-sign embeds in the signature
+// filename, derived from the basename of the configured public key path
+// (for an auto-generated key this is already the `<owner>@<fingerprint>`
+// abuild-keygen convention - see generateFingerprintedKeypair). It must
+// match pubKeyNameFromPrivate in the s3 pipe, since both end up signing
+// under `.SIGN.RSA.<name>.rsa.pub`.
+func signatureKeyName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".rsa.pub")
+	return strings.TrimSuffix(name, ".pub")
+}
+
+// toAlpineArch maps a GOARCH (plus GOARM, where relevant) to the arch name
+// Alpine repositories and `apk`'s own arch detection expect.
+func toAlpineArch(goarch, goarm string) string {
+	switch goarch {
+	case "386":
+		return "x86"
+	case "amd64":
+		return "x86_64"
+	case "arm":
+		if goarm == "6" {
+			return "armhf"
 		}
+		return "armv7"
+	case "arm64":
+		return "aarch64"
+	case "ppc64le":
+		return "ppc64le"
+	case "s390x":
+		return "s390x"
+	case "riscv64":
+		return "riscv64"
+	default:
+		return goarch
+	}
+}
+
+// runWithABuild is the legacy code path, kept for users who still want to
+// build inside an Alpine container with abuild/abuild-sign installed
+// (`alpine.use_abuild: true`).
+func runWithABuild(ctx *context.Context, alpine config.Alpine, localPath string, artifacts []artifact.Artifact) error {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	localPathAbs := filepath.Join(pwd, localPath)
+
+	apkBuild, err := generateApkBuildFile(ctx, alpine)
+	if err != nil {
+		return err
+	}
+
+	log.WithField(apkBuildFileName, localPath).Info("writing")
+	err = ioutil.WriteFile(filepath.Join(localPath, apkBuildFileName), apkBuild, 0644)
+
+	if _, err = exec.LookPath("abuild"); err != nil {
+		return err
+	}
+
+	repoPath := filepath.Join(alpine.Root, alpine.Branch, alpine.Repository)
+	pubKeyName := filepath.Dir(alpine.Key.PubKeyPath)
+
+	for _, binArtifact := range artifacts {
+		arch := toAlpineArch(binArtifact.Goarch, binArtifact.Goarm)
+
+		artifactRepoPath := filepath.Join(repoPath, arch)
+
+		binDir := filepath.Join(localPath, arch)
+		err := os.Mkdir(binDir, 0700)
+		if err != nil {
+			return err
+		}
+
+		binary, err := os.Open(binArtifact.Path)
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(binDir, filepath.Base(binArtifact.Path))
+		destination, err := os.Create(destPath)
+		if err != nil {
+			return err
+		}
+		os.Chmod(destPath, 0555)
+
+		_, err = io.Copy(destination, binary)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command("abuild", "-P", localPathAbs, "-r")
+		cmd.Env = append(os.Environ(), "CBUILD="+arch)
+		cmd.Dir = localPath
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s:\n%s", err, string(output))
+		}
+
+		artifactMeta := map[string]interface{}{
+			"AlpineArch": arch,
+		}
+
+		abuildOutputPath := filepath.Join(localPath, abuildOutputDir, arch)
+
+		apkFileName := fmt.Sprintf("%s-%s-r%d.apk", alpine.Name, ctx.Version, alpine.Rel)
+		apkFilePath := filepath.Join(abuildOutputPath, apkFileName)
+
+		ctx.Artifacts.Add(artifact.Artifact{
+			Type:    artifact.APK,
+			Name:    apkFileName,
+			Path:    apkFilePath,
+			Goos:    "linux",
+			Goarch:  binArtifact.Goarch,
+			Goarm:   "",
+			RepoDir: artifactRepoPath,
+			Extra:   artifactMeta,
+		})
+
+		apkIndexPath := filepath.Join(abuildOutputPath, apkIndexFileName)
+		apkIndexPathAbs := filepath.Join(pwd, apkIndexPath)
+
+		cmd = exec.Command("abuild-sign", apkIndexPathAbs, "-p", pubKeyName)
+		cmd.Dir = localPath
+		output, err = cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s:\n%s", err, string(output))
+		}
+
+		ctx.Artifacts.Add(artifact.Artifact{
+			Type:    artifact.APKIndex,
+			Name:    apkIndexFileName,
+			Path:    apkIndexPath,
+			Goos:    "linux",
+			Goarch:  binArtifact.Goarch,
+			Goarm:   "",
+			RepoDir: artifactRepoPath,
+			Extra:   artifactMeta,
+		})
 	}
 
 	return nil
@@ -0,0 +1,181 @@
+package alpine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// pkgInfo is the set of fields written to the .PKGINFO file embedded in the
+// control tarball of an .apk.
+type pkgInfo struct {
+	Name        string
+	Version     string
+	Description string
+	URL         string
+	BuildDate   int64
+	Packager    string
+	Size        int64
+	Arch        string
+	Origin      string
+	Commit      string
+	License     string
+	Depends     []string
+	Provides    []string
+}
+
+func (p pkgInfo) bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "pkgname = %s\n", p.Name)
+	fmt.Fprintf(&buf, "pkgver = %s\n", p.Version)
+	fmt.Fprintf(&buf, "pkgdesc = %s\n", p.Description)
+	fmt.Fprintf(&buf, "url = %s\n", p.URL)
+	fmt.Fprintf(&buf, "builddate = %d\n", p.BuildDate)
+	fmt.Fprintf(&buf, "packager = %s\n", p.Packager)
+	fmt.Fprintf(&buf, "size = %d\n", p.Size)
+	fmt.Fprintf(&buf, "arch = %s\n", p.Arch)
+	fmt.Fprintf(&buf, "origin = %s\n", p.Origin)
+	if p.Commit != "" {
+		fmt.Fprintf(&buf, "commit = %s\n", p.Commit)
+	}
+	fmt.Fprintf(&buf, "license = %s\n", p.License)
+	for _, dep := range p.Depends {
+		fmt.Fprintf(&buf, "depend = %s\n", dep)
+	}
+	for _, pr := range p.Provides {
+		fmt.Fprintf(&buf, "provides = %s\n", pr)
+	}
+	return buf.Bytes()
+}
+
+// tarFile is a single entry to be written into one of the apk's gzip'd tar
+// streams.
+type tarFile struct {
+	name string
+	mode int64
+	body []byte
+}
+
+// writeTarGz writes files as a gzip compressed tar stream, in order.
+func writeTarGz(files []tarFile) ([]byte, error) {
+	var raw bytes.Buffer
+	gw := gzip.NewWriter(&raw)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name: f.name,
+			Mode: f.mode,
+			Size: int64(len(f.body)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("apk: failed to write %s: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			return nil, fmt.Errorf("apk: failed to write %s: %w", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return raw.Bytes(), nil
+}
+
+// signTarGz signs data with key and wraps the signature in its own gzip'd
+// tar stream, as expected to be prepended to an .apk or APKINDEX.tar.gz.
+func signTarGz(data []byte, key *rsa.PrivateKey, pubKeyName string) ([]byte, error) {
+	hashed := sha1.Sum(data) // nolint: gosec
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("apk: failed to sign: %w", err)
+	}
+	return writeTarGz([]tarFile{
+		{
+			name: fmt.Sprintf(".SIGN.RSA.%s.rsa.pub", pubKeyName),
+			mode: 0644,
+			body: sig,
+		},
+	})
+}
+
+// sha1Checksum returns the apk-style `C:` checksum: a `Q1`-prefixed
+// base64 encoding of the SHA-1 sum of data.
+func sha1Checksum(data []byte) string {
+	sum := sha1.Sum(data) // nolint: gosec
+	return "Q1" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// buildAPK assembles an .apk file out of a signature, control and data
+// tarball and writes it to dest. It returns the uncompressed installed
+// size of the data tarball (for use in .PKGINFO/APKINDEX), the sha1
+// checksum of the control tarball (the APKINDEX `C:` field) and the
+// sha256 of the whole .apk (the APKINDEX `F:` field, used by apk to
+// verify the downloaded package before installing it).
+func buildAPK(dest string, info pkgInfo, binaries map[string]string, key *rsa.PrivateKey, pubKeyName string) (installedSize int64, checksum, dataHash string, err error) {
+	var dataFiles []tarFile
+	for name, path := range binaries {
+		body, rerr := os.ReadFile(path)
+		if rerr != nil {
+			return 0, "", "", fmt.Errorf("apk: failed to read %s: %w", path, rerr)
+		}
+		dataFiles = append(dataFiles, tarFile{
+			name: fmt.Sprintf("usr/bin/%s", name),
+			mode: 0755,
+			body: body,
+		})
+		installedSize += int64(len(body))
+	}
+
+	dataTarGz, err := writeTarGz(dataFiles)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	info.Size = installedSize
+	controlFiles := []tarFile{
+		{name: ".PKGINFO", mode: 0644, body: info.bytes()},
+	}
+	controlTarGz, err := writeTarGz(controlFiles)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	signatureTarGz, err := signTarGz(controlTarGz, key, pubKeyName)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer out.Close()
+
+	apkHash := sha256.New()
+	w := io.MultiWriter(out, apkHash)
+	for _, part := range [][]byte{signatureTarGz, controlTarGz, dataTarGz} {
+		if _, err := io.Copy(w, bytes.NewReader(part)); err != nil {
+			return 0, "", "", err
+		}
+	}
+
+	return installedSize, sha1Checksum(controlTarGz), hex.EncodeToString(apkHash.Sum(nil)), nil
+}
+
+func nowUnix() int64 {
+	return time.Now().Unix()
+}
@@ -0,0 +1,90 @@
+package alpine
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"os"
+)
+
+// indexEntry renders a single package's colon-prefixed stanza for the
+// APKINDEX file.
+type indexEntry struct {
+	Checksum      string // C
+	Name          string // P
+	Version       string // V
+	Arch          string // A
+	Size          int64  // S
+	InstalledSize int64  // I
+	Description   string // T
+	URL           string // U
+	License       string // L
+	Origin        string // o
+	BuildDate     int64  // t
+	DataHash      string // F: sha256 of the full .apk, for apk to verify contents on install
+	Depends       []string
+	Provides      []string
+}
+
+func (e indexEntry) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "C:%s\n", e.Checksum)
+	fmt.Fprintf(&buf, "P:%s\n", e.Name)
+	fmt.Fprintf(&buf, "V:%s\n", e.Version)
+	fmt.Fprintf(&buf, "A:%s\n", e.Arch)
+	fmt.Fprintf(&buf, "S:%d\n", e.Size)
+	fmt.Fprintf(&buf, "I:%d\n", e.InstalledSize)
+	fmt.Fprintf(&buf, "T:%s\n", e.Description)
+	fmt.Fprintf(&buf, "U:%s\n", e.URL)
+	fmt.Fprintf(&buf, "L:%s\n", e.License)
+	if e.Origin != "" {
+		fmt.Fprintf(&buf, "o:%s\n", e.Origin)
+	}
+	fmt.Fprintf(&buf, "t:%d\n", e.BuildDate)
+	if e.DataHash != "" {
+		fmt.Fprintf(&buf, "F:%s\n", e.DataHash)
+	}
+	for _, d := range e.Depends {
+		fmt.Fprintf(&buf, "D:%s\n", d)
+	}
+	for _, p := range e.Provides {
+		fmt.Fprintf(&buf, "p:%s\n", p)
+	}
+	return buf.String()
+}
+
+// buildAPKIndex assembles an APKINDEX.tar.gz (the description plus every
+// package entry, blank-line separated) and signs it, writing the final
+// `<signature><index>` stream to dest.
+func buildAPKIndex(dest, description string, entries []indexEntry, key *rsa.PrivateKey, pubKeyName string) error {
+	var body bytes.Buffer
+	for _, e := range entries {
+		body.WriteString(e.String())
+		body.WriteString("\n")
+	}
+
+	indexTarGz, err := writeTarGz([]tarFile{
+		{name: "DESCRIPTION", mode: 0644, body: []byte(description)},
+		{name: "APKINDEX", mode: 0644, body: body.Bytes()},
+	})
+	if err != nil {
+		return fmt.Errorf("apkindex: failed to build index tarball: %w", err)
+	}
+
+	signatureTarGz, err := signTarGz(indexTarGz, key, pubKeyName)
+	if err != nil {
+		return fmt.Errorf("apkindex: failed to sign index: %w", err)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := out.Write(signatureTarGz); err != nil {
+		return err
+	}
+	_, err = out.Write(indexTarGz)
+	return err
+}
@@ -0,0 +1,219 @@
+package alpine
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // nolint: gosec
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+
+	"github.com/goreleaser/goreleaser/internal/artifact"
+	"github.com/goreleaser/goreleaser/pkg/config"
+	"github.com/goreleaser/goreleaser/pkg/context"
+)
+
+const rsaKeyBits = 4096
+
+// ensureKeys makes sure alpine has a usable signing keypair before Run. A
+// configured KeyPath is always honored literally - generated there if
+// missing, reused as-is otherwise. With no KeyPath but AutoGenerate set, the
+// key lives under alpine.Root/keys (not dist/, which is wiped every release):
+// an existing keypair there is reused so the key doesn't change every
+// release, and a freshly generated one is named after its own fingerprint,
+// the same `<owner>@<fingerprint>.rsa` convention abuild-keygen uses. The
+// resolved public/private key paths are written back onto alpine so Run and
+// the s3 pipe can find them, and the public key is always registered as an
+// artifact so s3's alpine_repo mode can publish it no matter how it was
+// obtained.
+func ensureKeys(ctx *context.Context, alpine *config.Alpine) error {
+	if !alpine.Key.AutoGenerate && alpine.Key.KeyPath == "" {
+		if pubKeyPath == "" || privKeyPath == "" {
+			return ErrNoAlpineKeys
+		}
+		alpine.Key.PubKeyPath = pubKeyPath
+		alpine.Key.PrivKeyPath = privKeyPath
+		registerPubKeyArtifact(ctx, alpine.Key.PubKeyPath)
+		return nil
+	}
+
+	if alpine.Key.KeyPath != "" {
+		return ensureKeyAt(ctx, alpine, alpine.Key.KeyPath)
+	}
+
+	keysDir := filepath.Join(alpine.Root, "keys")
+
+	if privPath, pubPath := findExistingKeypair(keysDir); privPath != "" {
+		alpine.Key.PrivKeyPath = privPath
+		alpine.Key.PubKeyPath = pubPath
+		registerPubKeyArtifact(ctx, pubPath)
+		return nil
+	}
+
+	if err := os.MkdirAll(keysDir, 0700); err != nil {
+		return err
+	}
+
+	privPath, pubPath, err := generateFingerprintedKeypair(keysDir, alpine.Maintainer)
+	if err != nil {
+		return fmt.Errorf("alpine: failed to generate signing keypair: %w", err)
+	}
+
+	log.WithField("pub", pubPath).Info("generated alpine signing key")
+
+	alpine.Key.PubKeyPath = pubPath
+	alpine.Key.PrivKeyPath = privPath
+
+	ctx.Artifacts.Add(artifact.Artifact{
+		Type: artifact.APKSignPrivateKey,
+		Name: filepath.Base(privPath),
+		Path: privPath,
+	})
+
+	registerPubKeyArtifact(ctx, pubPath)
+	return nil
+}
+
+// ensureKeyAt generates a keypair at the literal configured privPath if one
+// isn't already there, honoring the user's chosen path/name exactly rather
+// than renaming it to the fingerprint convention.
+func ensureKeyAt(ctx *context.Context, alpine *config.Alpine, privPath string) error {
+	pubPath := privPath + ".pub"
+
+	if _, err := os.Stat(privPath); err == nil {
+		alpine.Key.PrivKeyPath = privPath
+		alpine.Key.PubKeyPath = pubPath
+		registerPubKeyArtifact(ctx, pubPath)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(privPath), 0700); err != nil {
+		return err
+	}
+
+	if err := generateKeypairAt(privPath, pubPath); err != nil {
+		return fmt.Errorf("alpine: failed to generate signing keypair: %w", err)
+	}
+
+	log.WithField("pub", pubPath).Info("generated alpine signing key")
+
+	alpine.Key.PrivKeyPath = privPath
+	alpine.Key.PubKeyPath = pubPath
+
+	ctx.Artifacts.Add(artifact.Artifact{
+		Type: artifact.APKSignPrivateKey,
+		Name: filepath.Base(privPath),
+		Path: privPath,
+	})
+
+	registerPubKeyArtifact(ctx, pubPath)
+	return nil
+}
+
+// findExistingKeypair looks for a previously generated `*.rsa`/`*.rsa.pub`
+// pair under dir, so a key minted on an earlier run is reused rather than
+// re-minted - its name depends on its own fingerprint, so it can't be
+// predicted up front and has to be discovered instead.
+func findExistingKeypair(dir string) (privPath, pubPath string) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.rsa"))
+	if err != nil || len(matches) == 0 {
+		return "", ""
+	}
+	privPath = matches[0]
+	pubPath = privPath + ".pub"
+	if _, err := os.Stat(pubPath); err != nil {
+		return "", ""
+	}
+	return privPath, pubPath
+}
+
+// registerPubKeyArtifact adds the alpine signing public key as an
+// APKSignKey artifact regardless of how it was resolved (generated,
+// configured via key_path, or supplied through the PACKAGER_PUBKEY/
+// PACKAGER_PRIVKEY environment variables).
+func registerPubKeyArtifact(ctx *context.Context, pubPath string) {
+	ctx.Artifacts.Add(artifact.Artifact{
+		Type: artifact.APKSignKey,
+		Name: filepath.Base(pubPath),
+		Path: pubPath,
+	})
+}
+
+// generateFingerprintedKeypair generates a 4096-bit RSA keypair under dir,
+// naming it after the SHA-1 fingerprint of its DER-encoded
+// SubjectPublicKeyInfo - the `<owner>@<fingerprint>.rsa`/`.rsa.pub`
+// convention used by abuild-keygen and Alpine's own repository servers.
+func generateFingerprintedKeypair(dir, owner string) (privPath, pubPath string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+
+	fp, err := fingerprint(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := fp
+	if owner != "" {
+		name = fmt.Sprintf("%s@%s", owner, fp)
+	}
+
+	privPath = filepath.Join(dir, name+".rsa")
+	pubPath = filepath.Join(dir, name+".rsa.pub")
+
+	if err := writeKeypair(key, privPath, pubPath); err != nil {
+		return "", "", err
+	}
+
+	return privPath, pubPath, nil
+}
+
+// fingerprint returns the first 16 hex characters of the SHA-1 sum of the
+// DER-encoded SubjectPublicKeyInfo, used to name Alpine signing keys.
+func fingerprint(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(der) // nolint: gosec
+	return fmt.Sprintf("%x", sum)[:16], nil
+}
+
+// generateKeypairAt generates a 4096-bit RSA keypair and PEM-encodes both
+// halves to the exact paths given, so a configured key_path is honored
+// literally rather than renamed after some derived value.
+func generateKeypairAt(privPath, pubPath string) error {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return err
+	}
+	return writeKeypair(key, privPath, pubPath)
+}
+
+// writeKeypair PEM-encodes key and writes its private (PKCS1) and public
+// (PKIX) halves to privPath/pubPath.
+func writeKeypair(key *rsa.PrivateKey, privPath, pubPath string) error {
+	privPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(privPath, privPEM, 0600); err != nil {
+		return err
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubDER,
+	})
+	return ioutil.WriteFile(pubPath, pubPEM, 0644)
+}
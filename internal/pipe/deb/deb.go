@@ -0,0 +1,226 @@
+// Package deb provides a Pipe that assembles a `.deb` artifacts produced by
+// nfpm into a real Debian repository (Packages/Release/InRelease) suitable
+// for `apt` to consume, the Debian analogue of the alpine pipe.
+package deb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+
+	"github.com/goreleaser/goreleaser/internal/artifact"
+	"github.com/goreleaser/goreleaser/internal/pipe"
+	"github.com/goreleaser/goreleaser/pkg/config"
+	"github.com/goreleaser/goreleaser/pkg/context"
+)
+
+// Pipe for deb repository publishing
+type Pipe struct{}
+
+// String returns the description of the pipe
+func (Pipe) String() string {
+	return "Debian repository"
+}
+
+// Default sets the pipe defaults
+func (Pipe) Default(ctx *context.Context) error {
+	for i := range ctx.Config.Deb {
+		deb := &ctx.Config.Deb[i]
+
+		if deb.Root == "" {
+			deb.Root = "deb"
+		}
+
+		if len(deb.Distributions) == 0 {
+			deb.Distributions = []config.DebDistribution{
+				{Name: "stable", Components: []string{"main"}},
+			}
+		}
+		for j := range deb.Distributions {
+			if len(deb.Distributions[j].Components) == 0 {
+				deb.Distributions[j].Components = []string{"main"}
+			}
+		}
+	}
+	return nil
+}
+
+// Run the pipe
+func (Pipe) Run(ctx *context.Context) error {
+	if len(ctx.Config.Deb) == 0 {
+		return pipe.Skip("deb section is not configured")
+	}
+
+	for _, deb := range ctx.Config.Deb {
+		if err := doRun(ctx, deb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doRun(ctx *context.Context, deb config.Deb) error {
+	debs := ctx.Artifacts.Filter(
+		artifact.And(
+			artifact.ByType(artifact.LinuxPackage),
+			byDebFormat,
+		),
+	).List()
+
+	log.Debugf("will package %d deb artifacts", len(debs))
+
+	localPath := filepath.Join(ctx.Config.Dist, "deb-"+deb.Name)
+	if err := os.MkdirAll(localPath, 0700); err != nil {
+		return err
+	}
+
+	for _, dist := range deb.Distributions {
+		for _, component := range dist.Components {
+			if err := publishComponent(ctx, deb, localPath, dist, component, debs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func byDebFormat(a artifact.Artifact) bool {
+	format, _ := a.Extra["Format"].(string)
+	return format == "deb"
+}
+
+// copyFile copies src into dst so the .deb nfpm produced ends up alongside
+// the Packages file that references it.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func publishComponent(ctx *context.Context, deb config.Deb, localPath string, dist config.DebDistribution, component string, debs []artifact.Artifact) error {
+	byArch := map[string][]artifact.Artifact{}
+	for _, d := range debs {
+		byArch[toDebArch(d.Goarch, d.Goarm)] = append(byArch[toDebArch(d.Goarch, d.Goarm)], d)
+	}
+
+	distPath := filepath.Join(localPath, "dists", dist.Name)
+	repoRoot := filepath.Join(deb.Root, "dists", dist.Name)
+
+	var releaseFiles []releaseFile
+	var archs []string
+
+	for arch, arts := range byArch {
+		archs = append(archs, arch)
+
+		binaryDir := filepath.Join(distPath, component, fmt.Sprintf("binary-%s", arch))
+		if err := os.MkdirAll(binaryDir, 0700); err != nil {
+			return err
+		}
+
+		binaryRepoPath := filepath.Join(repoRoot, component, fmt.Sprintf("binary-%s", arch))
+		archiveBinaryPath := filepath.Join("dists", dist.Name, component, fmt.Sprintf("binary-%s", arch))
+
+		packagesPath := filepath.Join(binaryDir, "Packages")
+		if err := writePackagesFile(packagesPath, deb, ctx.Version, arts, archiveBinaryPath); err != nil {
+			return err
+		}
+
+		for _, d := range arts {
+			debPath := filepath.Join(binaryDir, d.Name)
+			if err := copyFile(d.Path, debPath); err != nil {
+				return err
+			}
+			ctx.Artifacts.Add(artifact.Artifact{
+				Type:    artifact.DebRepoMetadata,
+				Name:    d.Name,
+				Path:    debPath,
+				Goos:    "linux",
+				Goarch:  arch,
+				RepoDir: binaryRepoPath,
+			})
+		}
+
+		variants, err := compressPackagesFile(packagesPath)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			rel, err := filepath.Rel(distPath, v)
+			if err != nil {
+				return err
+			}
+			hashes, err := hashFile(v)
+			if err != nil {
+				return err
+			}
+			releaseFiles = append(releaseFiles, releaseFile{path: rel, hashes: hashes})
+
+			ctx.Artifacts.Add(artifact.Artifact{
+				Type:    artifact.DebRepoMetadata,
+				Name:    filepath.Base(v),
+				Path:    v,
+				Goos:    "linux",
+				Goarch:  arch,
+				RepoDir: binaryRepoPath,
+			})
+		}
+	}
+
+	releasePath := filepath.Join(distPath, "Release")
+	if err := writeReleaseFile(releasePath, ctx, deb, dist, archs, releaseFiles); err != nil {
+		return err
+	}
+
+	if err := signRelease(deb, distPath); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"Release", "Release.gpg", "InRelease"} {
+		path := filepath.Join(distPath, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		ctx.Artifacts.Add(artifact.Artifact{
+			Type:    artifact.DebRepoMetadata,
+			Name:    name,
+			Path:    path,
+			Goos:    "linux",
+			RepoDir: repoRoot,
+		})
+	}
+
+	return nil
+}
+
+// toDebArch maps a GOARCH (plus GOARM, where relevant) to the arch name
+// Debian repositories use.
+func toDebArch(goarch, goarm string) string {
+	switch goarch {
+	case "386":
+		return "i386"
+	case "arm":
+		if goarm == "6" {
+			return "armel"
+		}
+		return "armhf"
+	case "ppc64le":
+		return "ppc64el"
+	default:
+		return goarch
+	}
+}
@@ -0,0 +1,158 @@
+package deb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5" // nolint: gosec
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/goreleaser/goreleaser/internal/artifact"
+	"github.com/goreleaser/goreleaser/pkg/config"
+	"github.com/ulikunitz/xz"
+)
+
+// debStanza is a single package's RFC822-style entry in a Packages file.
+type debStanza struct {
+	Package      string
+	Version      string
+	Architecture string
+	Maintainer   string
+	Depends      string
+	Filename     string
+	Size         int64
+	SHA256       string
+	Description  string
+}
+
+func (s debStanza) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Package: %s\n", s.Package)
+	fmt.Fprintf(&buf, "Version: %s\n", s.Version)
+	fmt.Fprintf(&buf, "Architecture: %s\n", s.Architecture)
+	if s.Maintainer != "" {
+		fmt.Fprintf(&buf, "Maintainer: %s\n", s.Maintainer)
+	}
+	if s.Depends != "" {
+		fmt.Fprintf(&buf, "Depends: %s\n", s.Depends)
+	}
+	fmt.Fprintf(&buf, "Filename: %s\n", s.Filename)
+	fmt.Fprintf(&buf, "Size: %d\n", s.Size)
+	fmt.Fprintf(&buf, "SHA256: %s\n", s.SHA256)
+	if s.Description != "" {
+		fmt.Fprintf(&buf, "Description: %s\n", s.Description)
+	}
+	return buf.String()
+}
+
+// writePackagesFile renders the Packages file for every .deb in arts,
+// referencing them at archivePath - relative to the archive root (the
+// directory that holds dists/), which is what apt resolves Filename
+// against, not wherever deb.Root places the archive in the bucket.
+func writePackagesFile(dest string, deb config.Deb, version string, arts []artifact.Artifact, archivePath string) error {
+	var buf bytes.Buffer
+	for _, art := range arts {
+		fi, err := os.Stat(art.Path)
+		if err != nil {
+			return err
+		}
+
+		sum, err := sha256Of(art.Path)
+		if err != nil {
+			return err
+		}
+
+		stanza := debStanza{
+			Package:      deb.Name,
+			Version:      version,
+			Architecture: toDebArch(art.Goarch, art.Goarm),
+			Maintainer:   deb.Maintainer,
+			Filename:     archivePath + "/" + art.Name,
+			Size:         fi.Size(),
+			SHA256:       sum,
+			Description:  deb.Description,
+		}
+		buf.WriteString(stanza.String())
+		buf.WriteString("\n")
+	}
+
+	return ioutil.WriteFile(dest, buf.Bytes(), 0644)
+}
+
+// compressPackagesFile writes the .gz and .xz variants of a Packages file
+// next to the original, returning all three paths.
+func compressPackagesFile(path string) ([]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gzPath := path + ".gz"
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	if _, err := gw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(gzPath, gzBuf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	xzPath := path + ".xz"
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := xw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := xw.Close(); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(xzPath, xzBuf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	return []string{path, gzPath, xzPath}, nil
+}
+
+type fileHashes struct {
+	md5    string
+	sha1   string
+	sha256 string
+	size   int64
+}
+
+func hashFile(path string) (fileHashes, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fileHashes{}, err
+	}
+
+	md5sum := md5.Sum(raw)   // nolint: gosec
+	sha1sum := sha1.Sum(raw) // nolint: gosec
+	sha256sum := sha256.Sum256(raw)
+
+	return fileHashes{
+		md5:    hex.EncodeToString(md5sum[:]),
+		sha1:   hex.EncodeToString(sha1sum[:]),
+		sha256: hex.EncodeToString(sha256sum[:]),
+		size:   int64(len(raw)),
+	}, nil
+}
+
+func sha256Of(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,92 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/pkg/config"
+	"github.com/goreleaser/goreleaser/pkg/context"
+)
+
+// releaseFile is a single entry in a Release file's MD5Sum/SHA1/SHA256
+// blocks: the path (relative to the distribution root) and its hashes.
+type releaseFile struct {
+	path   string
+	hashes fileHashes
+}
+
+// writeReleaseFile renders the apt Release file for a distribution: its
+// Suite/Codename/Components/Architectures header plus a hash block per
+// algorithm, each listing every Packages variant produced for it.
+func writeReleaseFile(dest string, ctx *context.Context, deb config.Deb, dist config.DebDistribution, archs []string, files []releaseFile) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Origin: %s\n", deb.Name)
+	fmt.Fprintf(&buf, "Label: %s\n", deb.Name)
+	fmt.Fprintf(&buf, "Suite: %s\n", dist.Name)
+	fmt.Fprintf(&buf, "Codename: %s\n", dist.Name)
+	fmt.Fprintf(&buf, "Components: %s\n", strings.Join(dist.Components, " "))
+	fmt.Fprintf(&buf, "Architectures: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(&buf, "Date: %s\n", ctx.Date.UTC().Format("Mon, 02 Jan 2006 15:04:05 UTC"))
+
+	buf.WriteString("MD5Sum:\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, " %s %d %s\n", f.hashes.md5, f.hashes.size, f.path)
+	}
+	buf.WriteString("SHA1:\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, " %s %d %s\n", f.hashes.sha1, f.hashes.size, f.path)
+	}
+	buf.WriteString("SHA256:\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, " %s %d %s\n", f.hashes.sha256, f.hashes.size, f.path)
+	}
+
+	return os.WriteFile(dest, buf.Bytes(), 0644)
+}
+
+// signRelease detached-signs dist/Release into Release.gpg and produces a
+// clear-signed InRelease as the configured key id, through gpg and whatever
+// keys its agent/keyring holds. If `deb.signing.key_path` is set, that key
+// file is imported first. Without a key id nothing is signed.
+func signRelease(deb config.Deb, distPath string) error {
+	if deb.Signing.KeyID == "" {
+		return nil
+	}
+
+	releasePath := filepath.Join(distPath, "Release")
+
+	if deb.Signing.KeyPath != "" {
+		if err := importKey(deb.Signing.KeyPath); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"--batch", "--yes", "--local-user", deb.Signing.KeyID}
+
+	if err := runGPG(append(append([]string{}, args...), "--armor", "--detach-sign", "--output", filepath.Join(distPath, "Release.gpg"), releasePath)...); err != nil {
+		return fmt.Errorf("deb: failed to sign Release: %w", err)
+	}
+
+	if err := runGPG(append(append([]string{}, args...), "--clear-sign", "--output", filepath.Join(distPath, "InRelease"), releasePath)...); err != nil {
+		return fmt.Errorf("deb: failed to clear-sign InRelease: %w", err)
+	}
+
+	return nil
+}
+
+func importKey(keyPath string) error {
+	return runGPG("--batch", "--yes", "--import", keyPath)
+}
+
+func runGPG(args ...string) error {
+	cmd := exec.Command("gpg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s:\n%s", err, string(output))
+	}
+	return nil
+}
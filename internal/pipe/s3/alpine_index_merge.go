@@ -0,0 +1,216 @@
+package s3
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // nolint: gosec
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mergeAndSignIndex merges the package stanzas found in newIndexPath into
+// the already-published index read from remote, re-signs the result with
+// the key at privKeyPath, and writes it to a temporary file whose path is
+// returned.
+func mergeAndSignIndex(remote io.Reader, newIndexPath, privKeyPath string) (string, error) {
+	remoteDesc, remoteStanzas, err := readAPKIndex(remote)
+	if err != nil {
+		return "", fmt.Errorf("s3: failed to read remote APKINDEX: %w", err)
+	}
+
+	newFile, err := os.Open(newIndexPath)
+	if err != nil {
+		return "", err
+	}
+	defer newFile.Close()
+
+	newDesc, newStanzas, err := readAPKIndex(newFile)
+	if err != nil {
+		return "", fmt.Errorf("s3: failed to read new APKINDEX: %w", err)
+	}
+
+	desc := newDesc
+	if desc == "" {
+		desc = remoteDesc
+	}
+
+	merged := mergeStanzas(remoteStanzas, newStanzas)
+
+	key, err := loadRSAPrivateKey(privKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("s3: failed to load re-signing key: %w", err)
+	}
+
+	out, err := ioutil.TempFile("", "APKINDEX-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if err := writeSignedIndex(out, desc, merged, key, pubKeyNameFromPrivate(privKeyPath)); err != nil {
+		return "", err
+	}
+
+	return out.Name(), nil
+}
+
+// mergeStanzas keeps every remote stanza whose `P:`/`V:` pair isn't present
+// in fresh, then appends fresh on top, so newer package builds win.
+func mergeStanzas(remote, fresh []string) []string {
+	seen := map[string]bool{}
+	for _, s := range fresh {
+		seen[stanzaKey(s)] = true
+	}
+
+	var merged []string
+	for _, s := range remote {
+		if !seen[stanzaKey(s)] {
+			merged = append(merged, s)
+		}
+	}
+	return append(merged, fresh...)
+}
+
+func stanzaKey(stanza string) string {
+	var name, version string
+	for _, line := range strings.Split(stanza, "\n") {
+		switch {
+		case strings.HasPrefix(line, "P:"):
+			name = strings.TrimPrefix(line, "P:")
+		case strings.HasPrefix(line, "V:"):
+			version = strings.TrimPrefix(line, "V:")
+		}
+	}
+	return name + "-" + version
+}
+
+// readAPKIndex reads an APKINDEX.tar.gz stream and returns its DESCRIPTION
+// and the blank-line separated package stanzas it contains. The stream is
+// the concatenation of a signature tarball followed by the index tarball
+// (see alpine.buildAPKIndex); each is read as its own gzip member with
+// Multistream disabled so the reader stops exactly at the member boundary.
+func readAPKIndex(r io.Reader) (description string, stanzas []string, err error) {
+	br := bufio.NewReader(r)
+
+	for {
+		if _, peekErr := br.Peek(1); peekErr != nil {
+			break
+		}
+
+		gr, gerr := gzip.NewReader(br)
+		if gerr != nil {
+			return "", nil, gerr
+		}
+		gr.Multistream(false)
+
+		tr := tar.NewReader(gr)
+		for {
+			hdr, terr := tr.Next()
+			if terr == io.EOF {
+				break
+			}
+			if terr != nil {
+				return "", nil, terr
+			}
+			body, rerr := ioutil.ReadAll(tr)
+			if rerr != nil {
+				return "", nil, rerr
+			}
+			switch hdr.Name {
+			case "DESCRIPTION":
+				description = string(body)
+			case "APKINDEX":
+				for _, stanza := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+					if strings.TrimSpace(stanza) != "" {
+						stanzas = append(stanzas, stanza)
+					}
+				}
+			}
+		}
+		gr.Close()
+	}
+
+	return description, stanzas, nil
+}
+
+func writeSignedIndex(w io.Writer, description string, stanzas []string, key *rsa.PrivateKey, pubKeyName string) error {
+	var body bytes.Buffer
+	for _, s := range stanzas {
+		body.WriteString(s)
+		body.WriteString("\n\n")
+	}
+
+	indexTarGz, err := tarGz(map[string][]byte{
+		"DESCRIPTION": []byte(description),
+		"APKINDEX":    body.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	hashed := sha1.Sum(indexTarGz) // nolint: gosec
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hashed[:])
+	if err != nil {
+		return err
+	}
+	sigTarGz, err := tarGz(map[string][]byte{
+		fmt.Sprintf(".SIGN.RSA.%s.rsa.pub", pubKeyName): sig,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(sigTarGz); err != nil {
+		return err
+	}
+	_, err = w.Write(indexTarGz)
+	return err
+}
+
+func tarGz(files map[string][]byte) ([]byte, error) {
+	var raw bytes.Buffer
+	gw := gzip.NewWriter(&raw)
+	tw := tar.NewWriter(gw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(body); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return raw.Bytes(), nil
+}
+
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from %s", path)
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func pubKeyNameFromPrivate(privKeyPath string) string {
+	return filepath.Base(strings.TrimSuffix(privKeyPath, ".rsa"))
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/goreleaser/goreleaser/internal/artifact"
+	"github.com/goreleaser/goreleaser/internal/semerrgroup"
+	"github.com/goreleaser/goreleaser/internal/tmpl"
+	"github.com/goreleaser/goreleaser/pkg/config"
+	"github.com/goreleaser/goreleaser/pkg/context"
+	"github.com/pkg/errors"
+)
+
+const (
+	apkContentType        = "application/x-tar"
+	apkIndexContentType   = "application/octet-stream"
+	pemContentType        = "application/x-pem-file"
+	noCacheCacheControl   = "no-cache"
+	longLivedCacheControl = "public, max-age=31536000, immutable"
+)
+
+// modeAlpineRepo is the s3[].mode value that turns the S3 pipe into a
+// full Alpine repository publisher: `<folder>/<root>/<branch>/<repository>/<arch>/`
+// plus the signing key at a stable, well-known path, ready to be consumed
+// as an `apk add` repository URL.
+const modeAlpineRepo = "alpine_repo"
+
+// uploadAlpineRepo publishes every apk/apkindex/sign-key artifact laid out
+// the way `apk add` expects a repository to look.
+func uploadAlpineRepo(ctx *context.Context, conf config.S3) error {
+	svc := newS3Svc(conf)
+
+	template := tmpl.New(ctx)
+	bucket, err := template.Apply(conf.Bucket)
+	if err != nil {
+		return err
+	}
+	folder, err := template.Apply(conf.Folder)
+	if err != nil {
+		return err
+	}
+
+	keys := ctx.Artifacts.Filter(artifact.ByType(artifact.APKSignKey)).List()
+	for _, key := range keys {
+		if err := uploadAlpineKey(ctx, svc, bucket, folder, key, conf); err != nil {
+			return err
+		}
+	}
+
+	byRepoDir := map[string][]artifact.Artifact{}
+	for _, art := range ctx.Artifacts.Filter(
+		artifact.Or(
+			artifact.ByType(artifact.APK),
+			artifact.ByType(artifact.APKIndex),
+		),
+	).List() {
+		byRepoDir[art.RepoDir] = append(byRepoDir[art.RepoDir], art)
+	}
+
+	var g = semerrgroup.New(ctx.Parallelism)
+	for repoDir, arts := range byRepoDir {
+		repoDir := repoDir
+		arts := arts
+		g.Go(func() error {
+			return uploadAlpineRepoDir(ctx, svc, bucket, folder, repoDir, arts, conf)
+		})
+	}
+	return g.Wait()
+}
+
+func uploadAlpineRepoDir(ctx *context.Context, svc *s3.S3, bucket, folder, repoDir string, arts []artifact.Artifact, conf config.S3) error {
+	var indexArt *artifact.Artifact
+	for i := range arts {
+		art := arts[i]
+		if art.Type == artifact.APKIndex {
+			indexArt = &arts[i]
+			continue
+		}
+
+		key := filepath.Join(folder, repoDir, art.Name)
+		if err := uploadAlpineObject(ctx, svc, bucket, key, art.Path, apkContentType, longLivedCacheControl, conf); err != nil {
+			return err
+		}
+	}
+
+	if indexArt == nil {
+		return nil
+	}
+
+	indexPath := indexArt.Path
+	if conf.MergeIndex {
+		merged, err := mergeAlpineIndex(ctx, svc, bucket, filepath.Join(folder, repoDir, indexArt.Name), indexArt, conf)
+		if err != nil {
+			return err
+		}
+		indexPath = merged
+	}
+
+	key := filepath.Join(folder, repoDir, indexArt.Name)
+	return uploadAlpineObject(ctx, svc, bucket, key, indexPath, apkIndexContentType, noCacheCacheControl, conf)
+}
+
+func uploadAlpineKey(ctx *context.Context, svc *s3.S3, bucket, folder string, key artifact.Artifact, conf config.S3) error {
+	dest := filepath.Join(folder, "keys", key.Name)
+	return uploadAlpineObject(ctx, svc, bucket, dest, key.Path, pemContentType, longLivedCacheControl, conf)
+}
+
+func uploadAlpineObject(ctx *context.Context, svc *s3.S3, bucket, key, path, contentType, cacheControl string, conf config.S3) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.WithFields(log.Fields{
+		"bucket": bucket,
+		"key":    key,
+	}).Info("uploading to alpine repository")
+
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		Body:         f,
+		ACL:          aws.String(conf.ACL),
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String(cacheControl),
+	}
+	_, err = svc.PutObjectWithContext(ctx, input)
+	return err
+}
+
+// mergeAlpineIndex fetches the currently published APKINDEX.tar.gz (if
+// any), merges in the freshly built packages, re-signs the result and
+// writes it to a temporary location, returning its path.
+func mergeAlpineIndex(ctx *context.Context, svc *s3.S3, bucket, remoteKey string, newIndex *artifact.Artifact, conf config.S3) (string, error) {
+	if conf.KeyPath == "" {
+		return "", errors.New("s3: alpine_repo merge_index requires key_path to be set for re-signing")
+	}
+
+	existing, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(remoteKey),
+	})
+	if err != nil {
+		// nothing published yet: publish the freshly generated index as-is.
+		log.WithField("key", remoteKey).Debug("no existing APKINDEX found, publishing as-is")
+		return newIndex.Path, nil
+	}
+	defer existing.Body.Close()
+
+	return mergeAndSignIndex(existing.Body, newIndex.Path, conf.KeyPath)
+}
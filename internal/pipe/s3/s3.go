@@ -27,13 +27,15 @@ func (Pipe) String() string {
 
 var (
 	artifactTypes = map[string]artifact.Type{
-		"archive":   artifact.UploadableArchive,
-		"binary":    artifact.UploadableBinary,
-		"nfpm":      artifact.LinuxPackage,
-		"checksum":  artifact.Checksum,
-		"signature": artifact.Signature,
-		"apk":       artifact.APK,
-		"apkindex":  artifact.APKIndex,
+		"archive":      artifact.UploadableArchive,
+		"binary":       artifact.UploadableBinary,
+		"nfpm":         artifact.LinuxPackage,
+		"checksum":     artifact.Checksum,
+		"signature":    artifact.Signature,
+		"apk":          artifact.APK,
+		"apkindex":     artifact.APKIndex,
+		"apk-sign-key": artifact.APKSignKey,
+		"deb-repo":     artifact.DebRepoMetadata,
 	}
 )
 
@@ -66,6 +68,9 @@ func (Pipe) Publish(ctx *context.Context) error {
 	for _, conf := range ctx.Config.S3 {
 		conf := conf
 		g.Go(func() error {
+			if conf.Mode == modeAlpineRepo {
+				return uploadAlpineRepo(ctx, conf)
+			}
 			return upload(ctx, conf)
 		})
 	}
@@ -79,6 +84,12 @@ func newS3Svc(conf config.S3) *s3.S3 {
 		builder.Endpoint(conf.Endpoint)
 		builder.S3ForcePathStyle(true)
 	}
+	if conf.S3ForcePathStyle {
+		builder.S3ForcePathStyle(true)
+	}
+	if conf.DisableSSL {
+		builder.DisableSSL(true)
+	}
 	sess := builder.Build()
 
 	return s3.New(sess, &aws.Config{
@@ -109,6 +120,11 @@ func upload(ctx *context.Context, conf config.S3) error {
 		}
 	}
 
+	metadata, err := templatedMetadata(template, conf.Metadata)
+	if err != nil {
+		return err
+	}
+
 	var g = semerrgroup.New(ctx.Parallelism)
 	for _, artifact := range ctx.Artifacts.Filter(artifact.Or(filters...)).List() {
 		artifact := artifact
@@ -123,14 +139,101 @@ func upload(ctx *context.Context, conf config.S3) error {
 				"folder":   path,
 				"artifact": artifact.Name,
 			}).Info("uploading")
-			_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(path),
-				Body:   f,
-				ACL:    aws.String(conf.ACL),
-			})
+
+			input := &s3.PutObjectInput{
+				Bucket:       aws.String(bucket),
+				Key:          aws.String(path),
+				Body:         f,
+				ACL:          aws.String(conf.ACL),
+				ContentType:  aws.String(contentTypeFor(artifact)),
+				CacheControl: aws.String(cacheControlFor(artifact)),
+				Metadata:     metadata,
+			}
+			if conf.StorageClass != "" {
+				input.StorageClass = aws.String(conf.StorageClass)
+			}
+			if conf.SSE != "" {
+				input.ServerSideEncryption = aws.String(conf.SSE)
+			}
+			if conf.KMSKeyID != "" {
+				input.SSEKMSKeyId = aws.String(conf.KMSKeyID)
+			}
+
+			_, err = svc.PutObjectWithContext(ctx, input)
 			return err
 		})
 	}
 	return g.Wait()
 }
+
+// templatedMetadata applies tmpl to every value in metadata, so keys like
+// `git-commit` or `release-tag` can be templated the same way the rest of
+// the config is.
+func templatedMetadata(template *tmpl.Template, metadata map[string]string) (map[string]*string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		applied, err := template.Apply(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = aws.String(applied)
+	}
+	return out, nil
+}
+
+// contentTypeFor infers the Content-Type to upload an artifact with. It
+// looks at the file extension first, since artifact types like LinuxPackage
+// or DebRepoMetadata cover multiple real file formats (nfpm emits .deb,
+// .rpm and .apk; DebRepoMetadata covers the copied .deb as well as the
+// Packages/Release index files), and falls back to the artifact type for
+// files with any other extension, or none.
+func contentTypeFor(art artifact.Artifact) string {
+	switch filepath.Ext(art.Name) {
+	case ".deb":
+		return "application/vnd.debian.binary-package"
+	case ".rpm":
+		return "application/x-rpm"
+	case ".apk":
+		return apkContentType
+	case ".pub":
+		return pemContentType
+	case ".gz":
+		if art.Type == artifact.APKIndex {
+			return apkIndexContentType
+		}
+		return "application/gzip"
+	}
+
+	switch art.Type {
+	case artifact.APKIndex:
+		return apkIndexContentType
+	case artifact.APKSignKey:
+		return pemContentType
+	case artifact.UploadableArchive:
+		return "application/gzip"
+	case artifact.Checksum, artifact.DebRepoMetadata:
+		return "text/plain"
+	case artifact.Signature:
+		return "application/pgp-signature"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// cacheControlFor picks a Cache-Control value based on whether the
+// artifact is an immutable, versioned file or a repository index that
+// clients are expected to always refetch.
+func cacheControlFor(art artifact.Artifact) string {
+	if filepath.Ext(art.Name) == ".deb" {
+		return longLivedCacheControl
+	}
+	switch art.Type {
+	case artifact.APKIndex, artifact.DebRepoMetadata:
+		return noCacheCacheControl
+	default:
+		return longLivedCacheControl
+	}
+}